@@ -17,62 +17,245 @@ package tools
 
 import (
 	"context"
+	"encoding/json"
 	"os"
 	"strings"
 )
 
 const INITIAL_LOG_SIZE int = 255
 
+// Severity is the detected severity of a single buffered log line.
+type Severity int
+
+const (
+	// SeverityUnknown means no SeverityParser recognized the line. The
+	// caller-supplied default severity is used instead.
+	SeverityUnknown Severity = iota
+	SeverityDebug
+	SeverityInfo
+	SeverityWarn
+	SeverityError
+)
+
+// SeverityParser inspects a single line of subprocess output and reports
+// the severity it appears to have been logged at. Parsers are expected to
+// be cheap and side-effect free, since every buffered line is offered to
+// each configured parser in turn.
+type SeverityParser interface {
+	// Parse returns the detected severity for line, and ok=false if line
+	// doesn't match the format this parser understands.
+	Parse(line string) (sev Severity, ok bool)
+}
+
+// defaultSeverityParsers are tried, in order, against every buffered line.
+// They cover the SDKs whose container subprocess output Prism commonly
+// needs to relay: Python's logging module, Java's java.util.logging, and
+// Go's slog with a JSON handler.
+var defaultSeverityParsers = []SeverityParser{
+	PythonLoggingSeverityParser{},
+	JULSeverityParser{},
+	SlogJSONSeverityParser{},
+}
+
+// PythonLoggingSeverityParser recognizes lines emitted by Python's logging
+// package in its default format, eg. "WARNING:root:message".
+type PythonLoggingSeverityParser struct{}
+
+// Parse implements SeverityParser.
+func (PythonLoggingSeverityParser) Parse(line string) (Severity, bool) {
+	prefix, _, ok := strings.Cut(line, ":")
+	if !ok {
+		return SeverityUnknown, false
+	}
+	switch prefix {
+	case "CRITICAL", "ERROR":
+		return SeverityError, true
+	case "WARNING":
+		return SeverityWarn, true
+	case "INFO":
+		return SeverityInfo, true
+	case "DEBUG":
+		return SeverityDebug, true
+	}
+	return SeverityUnknown, false
+}
+
+// JULSeverityParser recognizes lines emitted by Java's java.util.logging,
+// eg. "SEVERE: message" or "INFO: message".
+type JULSeverityParser struct{}
+
+// Parse implements SeverityParser.
+func (JULSeverityParser) Parse(line string) (Severity, bool) {
+	prefix, _, ok := strings.Cut(line, ":")
+	if !ok {
+		return SeverityUnknown, false
+	}
+	switch prefix {
+	case "SEVERE":
+		return SeverityError, true
+	case "WARNING":
+		return SeverityWarn, true
+	case "INFO", "CONFIG":
+		return SeverityInfo, true
+	case "FINE", "FINER", "FINEST":
+		return SeverityDebug, true
+	}
+	return SeverityUnknown, false
+}
+
+// SlogJSONSeverityParser recognizes JSON lines emitted by Go's slog
+// package with the standard JSON handler, which carry a "level" field.
+type SlogJSONSeverityParser struct{}
+
+// Parse implements SeverityParser.
+func (SlogJSONSeverityParser) Parse(line string) (Severity, bool) {
+	var entry struct {
+		Level string `json:"level"`
+	}
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		return SeverityUnknown, false
+	}
+	switch strings.ToUpper(entry.Level) {
+	case "ERROR":
+		return SeverityError, true
+	case "WARN", "WARNING":
+		return SeverityWarn, true
+	case "INFO":
+		return SeverityInfo, true
+	case "DEBUG":
+		return SeverityDebug, true
+	}
+	return SeverityUnknown, false
+}
+
+// bufferedLine is a single, fully received line of subprocess output,
+// tagged with the severity a SeverityParser detected for it, if any.
+type bufferedLine struct {
+	text string
+	sev  Severity
+}
+
 // BufferedLogger is a wrapper around the FnAPI logging client meant to be used
 // in place of stdout and stderr in bootloader subprocesses. Not intended for
 // Beam end users.
 type BufferedLogger struct {
 	logger  *Logger
-	builder *strings.Builder
-	logs    []string
+	parsers []SeverityParser
+	partial strings.Builder
+	lines   []bufferedLine
 }
 
 // NewBufferedLogger returns a new BufferedLogger type by reference.
 func NewBufferedLogger(logger *Logger) *BufferedLogger {
-	return &BufferedLogger{logger: logger, builder: &strings.Builder{}}
+	return &BufferedLogger{logger: logger, parsers: defaultSeverityParsers}
 }
 
-// Write implements the io.Writer interface, converting input to a string
-// and storing it in the BufferedLogger's buffer. If a logger is not provided,
-// the output is sent directly to os.Stderr.
+// Write implements the io.Writer interface, splitting the input on line
+// boundaries and buffering one entry per complete line, tagged with its
+// detected severity. A trailing, not yet newline-terminated fragment is
+// held over and prepended to the next Write call. If a logger is not
+// provided, the output is sent directly to os.Stderr.
 func (b *BufferedLogger) Write(p []byte) (int, error) {
 	if b.logger == nil {
 		return os.Stderr.Write(p)
 	}
-	n, err := b.builder.Write(p)
-	if b.logs == nil {
-		b.logs = make([]string, 0, INITIAL_LOG_SIZE)
+	n := len(p)
+	if b.lines == nil {
+		b.lines = make([]bufferedLine, 0, INITIAL_LOG_SIZE)
+	}
+	b.partial.Write(p)
+	buffered := b.partial.String()
+	lines := strings.Split(buffered, "\n")
+	// The last element is either "" (buffered ended in a newline) or an
+	// incomplete trailing line to carry over to the next Write call.
+	b.partial.Reset()
+	b.partial.WriteString(lines[len(lines)-1])
+	for _, line := range lines[:len(lines)-1] {
+		b.lines = append(b.lines, bufferedLine{text: line, sev: b.detectSeverity(line)})
+	}
+	return n, nil
+}
+
+// detectSeverity offers line to each configured SeverityParser in turn,
+// returning the first detected severity, or SeverityUnknown if none
+// recognize it.
+func (b *BufferedLogger) detectSeverity(line string) Severity {
+	for _, p := range b.parsers {
+		if sev, ok := p.Parse(line); ok {
+			return sev
+		}
+	}
+	return SeverityUnknown
+}
+
+// DetectSeverity offers line to the default SeverityParsers, returning
+// the first detected severity, or SeverityUnknown if none recognize it.
+// It's exported so callers outside the bootloader process -- such as a
+// runner relaying a container's raw stdout/stderr through its own
+// logger -- can reuse the same per-line severity detection that
+// BufferedLogger.Write applies.
+func DetectSeverity(line string) Severity {
+	for _, p := range defaultSeverityParsers {
+		if sev, ok := p.Parse(line); ok {
+			return sev
+		}
+	}
+	return SeverityUnknown
+}
+
+// emit logs message at logger, substituting defaultSev for lines whose
+// severity couldn't be detected. SeverityError lines are logged with
+// Errorf; every other severity (Warn, Info, and Debug alike) is logged
+// with Printf, so those three aren't distinguished from each other.
+func (b *BufferedLogger) emit(ctx context.Context, sev, defaultSev Severity, message string) {
+	if sev == SeverityUnknown {
+		sev = defaultSev
+	}
+	switch sev {
+	case SeverityError:
+		b.logger.Errorf(ctx, message)
+	default:
+		b.logger.Printf(ctx, message)
 	}
-	b.logs = append(b.logs, b.builder.String())
-	b.builder.Reset()
-	return n, err
 }
 
-// FlushAtError flushes the contents of the buffer to the logging
-// service at Error.
+// flushPartial emits b.partial -- the trailing fragment Write held over
+// because it hadn't seen a newline yet -- as a final line, so output
+// that never ends in a newline (common for the last, often most
+// important, line of a crashing subprocess) isn't silently dropped.
+func (b *BufferedLogger) flushPartial(ctx context.Context, defaultSev Severity) {
+	if b.partial.Len() == 0 {
+		return
+	}
+	line := b.partial.String()
+	b.partial.Reset()
+	b.emit(ctx, b.detectSeverity(line), defaultSev, line)
+}
+
+// FlushAtError flushes the contents of the buffer to the logging service,
+// emitting each line through emit by its detected severity and falling
+// back to Error for lines whose severity couldn't be determined.
 func (b *BufferedLogger) FlushAtError(ctx context.Context) {
 	if b.logger == nil {
 		return
 	}
-	for _, message := range b.logs {
-		b.logger.Errorf(ctx, message)
+	for _, line := range b.lines {
+		b.emit(ctx, line.sev, SeverityError, line.text)
 	}
-	b.logs = nil
+	b.lines = nil
+	b.flushPartial(ctx, SeverityError)
 }
 
-// FlushAtDebug flushes the contents of the buffer to the logging
-// service at Debug.
+// FlushAtDebug flushes the contents of the buffer to the logging service,
+// emitting each line through emit by its detected severity and falling
+// back to Debug for lines whose severity couldn't be determined.
 func (b *BufferedLogger) FlushAtDebug(ctx context.Context) {
 	if b.logger == nil {
 		return
 	}
-	for _, message := range b.logs {
-		b.logger.Printf(ctx, message)
+	for _, line := range b.lines {
+		b.emit(ctx, line.sev, SeverityDebug, line.text)
 	}
-	b.logs = nil
+	b.lines = nil
+	b.flushPartial(ctx, SeverityDebug)
 }
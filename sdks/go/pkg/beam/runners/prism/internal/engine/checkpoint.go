@@ -0,0 +1,45 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import "github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+
+// StageCheckpoint is the persisted state needed to resume a single stage
+// of a pipeline: its still-pending, already-encoded elements, its
+// watermark holds, and its outstanding timers.
+type StageCheckpoint struct {
+	StageID    string
+	Pending    [][]byte
+	Watermarks map[string]mtime.Time
+	Timers     [][]byte
+}
+
+// Checkpointer persists and restores ElementManager state, so a job can
+// be resumed after a crash or deliberate restart without replaying from
+// scratch. Implementations must be safe for concurrent use, since the
+// Save* methods are called from the bundle-completion path of every
+// stage in the pipeline.
+type Checkpointer interface {
+	// SaveBundle persists a stage's still-pending, encoded elements.
+	SaveBundle(jobID, stageID string, pending [][]byte) error
+	// SaveWatermarks persists a stage's current watermark holds.
+	SaveWatermarks(jobID, stageID string, watermarks map[string]mtime.Time) error
+	// SaveTimers persists a stage's outstanding, encoded timer state.
+	SaveTimers(jobID, stageID string, timers [][]byte) error
+	// Load returns the persisted checkpoints for jobID, keyed by stage ID.
+	// It returns an empty map, not an error, if no checkpoint exists yet.
+	Load(jobID string) (map[string]*StageCheckpoint, error)
+}
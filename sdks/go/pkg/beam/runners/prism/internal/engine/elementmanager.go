@@ -0,0 +1,430 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+)
+
+// defaultBundleParallelism bounds the Bundles channel when the caller
+// leaves Config.MaxBundleParallelism unset (<= 0), so construction never
+// depends on an unbounded buffer.
+const defaultBundleParallelism = 8
+
+// Config is a set of options for an ElementManager, generally populated
+// from pipeline options or experiments by the caller, that adjust
+// runtime behaviors of the engine.
+type Config struct {
+	// EnableRTC turns on retracting trigger contexts.
+	EnableRTC bool
+
+	// MaxBundleParallelism caps the number of bundles the ElementManager
+	// will have buffered in Bundles, ready to run, at once. A value <= 0
+	// means the ElementManager picks its own default
+	// (defaultBundleParallelism).
+	MaxBundleParallelism int
+
+	// Checkpointer, if set, persists per-stage pending elements,
+	// watermark holds, and timers as the pipeline runs, so the job can
+	// be resumed from a checkpoint instead of starting from its
+	// impulses.
+	Checkpointer Checkpointer
+}
+
+// RunBundle identifies a unit of work ready for an executor to run:
+// stageID's next bundle, identified by bundleID.
+type RunBundle struct {
+	StageID  string
+	BundleID string
+}
+
+// WinStrat configures how a stage aggregates and emits panes for its
+// windows: how late data is tolerated, whether successive panes
+// accumulate prior results, and the Trigger controlling when a pane is
+// emitted.
+type WinStrat struct {
+	AllowedLateness time.Duration
+	Accumulating    bool
+	Trigger         Trigger
+}
+
+// stageState is the mutable runtime state the ElementManager tracks for a
+// single stage.
+type stageState struct {
+	mu sync.Mutex
+
+	// pending holds this stage's still-unprocessed encoded elements,
+	// watermarks its current watermark holds keyed by PCollection ID, and
+	// timers its outstanding, encoded timers. Together these are exactly
+	// the state a StageCheckpoint captures and LoadCheckpoint restores.
+	pending    [][]byte
+	watermarks map[string]mtime.Time
+	timers     [][]byte
+
+	// processingTimeTimerIDs are the user timer family IDs declared by
+	// the stage's DoFn that fire relative to processing time, as
+	// registered by StageProcessingTimeTimers.
+	processingTimeTimerIDs []string
+
+	// procTimeTrigger is the prototype Trigger for the stage's windowing
+	// strategy, set by StageAggregates only when the trigger actually has
+	// a processing-time component. procTimeTimers holds one clone of it
+	// per currently open window (keyed by an opaque window key), created
+	// lazily the first time an element lands in that window via
+	// NotePaneElement, and removed once it fires.
+	procTimeTrigger Trigger
+	procTimeTimers  map[string]*procTimeWindow
+}
+
+// procTimeWindow is a single open window's clone of its stage's
+// processing-time trigger, plus the processing time OnElement reported
+// the trigger should next be re-evaluated at, so AdvanceProcessingTime
+// can skip it until then instead of calling OnProcessingTime on every
+// tick.
+type procTimeWindow struct {
+	trigger  Trigger
+	nextWake mtime.Time
+}
+
+// ElementManager owns the runtime state of a running pipeline: the
+// pending elements, watermarks, and timers for every stage, and the
+// queue of bundles ready to execute.
+type ElementManager struct {
+	config Config
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	stages map[string]*stageState
+	ready  []RunBundle
+}
+
+// NewElementManager returns an ElementManager configured per config.
+func NewElementManager(config Config) *ElementManager {
+	em := &ElementManager{
+		config: config,
+		stages: map[string]*stageState{},
+	}
+	em.cond = sync.NewCond(&em.mu)
+	return em
+}
+
+// bundleParallelism is the capacity of the channel returned by Bundles:
+// once this many scheduled bundles are buffered waiting for a free
+// executor slot, further sends to it block, so a slow or saturated
+// executor applies backpressure to the rest of the pipeline instead of
+// the ElementManager queuing scheduled work unboundedly.
+func (em *ElementManager) bundleParallelism() int {
+	if em.config.MaxBundleParallelism > 0 {
+		return em.config.MaxBundleParallelism
+	}
+	return defaultBundleParallelism
+}
+
+// Impulse queues stageID's single bundle of synthetic impulse input, to
+// be scheduled once a consumer reads from Bundles.
+func (em *ElementManager) Impulse(stageID string) {
+	em.enqueue(RunBundle{StageID: stageID})
+}
+
+// FailBundle requeues rb, so a bundle that failed mid-execution is
+// retried rather than dropped.
+func (em *ElementManager) FailBundle(rb RunBundle) {
+	em.enqueue(rb)
+}
+
+func (em *ElementManager) enqueue(rb RunBundle) {
+	em.mu.Lock()
+	em.ready = append(em.ready, rb)
+	em.mu.Unlock()
+	em.cond.Broadcast()
+}
+
+// Bundles returns a channel of bundles ready to execute, buffered to
+// bundleParallelism, and starts the background scheduling goroutine that
+// feeds it from the queue built up by Impulse, FailBundle, and
+// ScheduleStage. The channel is closed once ctx is
+// done. cancelFn is accepted, matching the caller's context.CancelCauseFunc,
+// for the ElementManager to report an unrecoverable internal error in the
+// future; it isn't called today.
+func (em *ElementManager) Bundles(ctx context.Context, cancelFn func(error), genBundleID func() string) <-chan RunBundle {
+	out := make(chan RunBundle, em.bundleParallelism())
+
+	go func() {
+		<-ctx.Done()
+		// Broadcast under em.mu, so the wakeup can't slip in between the
+		// scheduler's ctx.Err check and its cond.Wait.
+		em.mu.Lock()
+		em.cond.Broadcast()
+		em.mu.Unlock()
+	}()
+
+	go func() {
+		defer close(out)
+		for {
+			em.mu.Lock()
+			for len(em.ready) == 0 && ctx.Err() == nil {
+				em.cond.Wait()
+			}
+			if ctx.Err() != nil {
+				em.mu.Unlock()
+				return
+			}
+			rb := em.ready[0]
+			em.ready = em.ready[1:]
+			em.mu.Unlock()
+
+			rb.BundleID = genBundleID()
+			select {
+			case out <- rb:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// stage returns stageID's runtime state, creating it if this is the
+// first time stageID has been seen.
+func (em *ElementManager) stage(stageID string) *stageState {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+	ss, ok := em.stages[stageID]
+	if !ok {
+		ss = &stageState{}
+		em.stages[stageID] = ss
+	}
+	return ss
+}
+
+// AddStage registers a stage with the ElementManager, so its watermarks
+// and timers can be tracked as the pipeline runs. ins, outs, and sides
+// name the stage's input, output, and side input PCollections; they
+// aren't recorded.
+func (em *ElementManager) AddStage(stageID string, ins, outs, sides []string) {
+	em.stage(stageID)
+}
+
+// FiredTrigger reports that stageID's window, identified by windowKey,
+// has had its processing-time trigger fire.
+type FiredTrigger struct {
+	StageID   string
+	WindowKey string
+}
+
+// StageAggregates records stageID's windowing strategy, including the
+// prototype Trigger evaluated for each of its windows. If ws.Trigger is
+// itself a TriggerAfterProcessingTime or
+// TriggerAfterSynchronizedProcessingTime, it's cloned per window and
+// driven by NotePaneElement and AdvanceProcessingTime as the stage runs.
+// Every other trigger is left untracked: the watermark- or count-based
+// triggers buildTrigger also produces, and also composite triggers (eg.
+// TriggerRepeatedly) even when they wrap a processing-time trigger.
+func (em *ElementManager) StageAggregates(stageID string, ws WinStrat) {
+	ss := em.stage(stageID)
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if !triggerNeedsProcessingTimeClock(ws.Trigger) {
+		ss.procTimeTrigger = nil
+		ss.procTimeTimers = nil
+		return
+	}
+	ss.procTimeTrigger = ws.Trigger
+	if ss.procTimeTimers == nil {
+		ss.procTimeTimers = map[string]*procTimeWindow{}
+	}
+}
+
+// triggerNeedsProcessingTimeClock reports whether t must be tracked
+// per-window and polled as local processing time advances, as opposed to
+// triggers (eg. TriggerDefault, TriggerAlways, TriggerElementCount) that
+// fire off the watermark or element counts alone. Only t's own type is
+// checked; sub-triggers of a composite trigger are not inspected.
+func triggerNeedsProcessingTimeClock(t Trigger) bool {
+	switch t.(type) {
+	case *TriggerAfterProcessingTime, *TriggerAfterSynchronizedProcessingTime:
+		return true
+	default:
+		return false
+	}
+}
+
+// StageProcessingTimeTimers registers the processing-time-keyed user
+// timer family IDs declared by stageID's DoFn, so the ElementManager
+// knows to schedule its bundles once local processing time reaches
+// their set time, rather than waiting on the watermark alone.
+func (em *ElementManager) StageProcessingTimeTimers(stageID string, timerIDs []string) {
+	ss := em.stage(stageID)
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.processingTimeTimerIDs = append([]string(nil), timerIDs...)
+}
+
+// NotePaneElement tells the ElementManager that an element arrived in
+// stageID's window windowKey at local processing time nowPT, so its
+// registered processing-time trigger (if any) can start, or continue,
+// timing the window's pane.
+func (em *ElementManager) NotePaneElement(stageID, windowKey string, nowPT mtime.Time) {
+	ss := em.stage(stageID)
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.procTimeTrigger == nil {
+		return
+	}
+	w, ok := ss.procTimeTimers[windowKey]
+	if !ok {
+		t := ss.procTimeTrigger.Clone()
+		t.OnNewWindow()
+		w = &procTimeWindow{trigger: t}
+		ss.procTimeTimers[windowKey] = w
+	}
+	w.nextWake = w.trigger.OnElement(nowPT)
+}
+
+// AdvanceProcessingTime evaluates every stage's open processing-time
+// triggers against the new local processing-time watermark nowPT,
+// returning the stage/window pairs whose trigger fired so their panes
+// can be emitted downstream. A window is only re-evaluated once nowPT
+// reaches the target OnElement last reported for it, rather than on
+// every call. Fired triggers are removed from the window's tracked
+// state, since the triggers they wrap are one-shot.
+func (em *ElementManager) AdvanceProcessingTime(nowPT mtime.Time) []FiredTrigger {
+	em.mu.Lock()
+	stages := make(map[string]*stageState, len(em.stages))
+	for id, ss := range em.stages {
+		stages[id] = ss
+	}
+	em.mu.Unlock()
+
+	var fired []FiredTrigger
+	for stageID, ss := range stages {
+		ss.mu.Lock()
+		for windowKey, w := range ss.procTimeTimers {
+			if nowPT < w.nextWake {
+				continue
+			}
+			if w.trigger.OnProcessingTime(nowPT) {
+				fired = append(fired, FiredTrigger{StageID: stageID, WindowKey: windowKey})
+				delete(ss.procTimeTimers, windowKey)
+			}
+		}
+		ss.mu.Unlock()
+	}
+	return fired
+}
+
+// ScheduleStage enqueues stageID's next bundle to run, for cases -- like
+// a processing-time trigger firing -- where the stage has pending state
+// to act on but didn't just receive a fresh impulse or a retried bundle.
+func (em *ElementManager) ScheduleStage(stageID string) {
+	em.enqueue(RunBundle{StageID: stageID})
+}
+
+// AddPending appends newly produced, still-unprocessed encoded elements
+// to stageID's pending queue -- so they're included in its next
+// Checkpoint instead of only living in the bundle that produced them --
+// and notes their arrival in windowKey at local processing time nowPT
+// against the stage's processing-time trigger, if any. stage.Execute is
+// expected to call this once per window of output a bundle produces,
+// using the ElementManager already threaded through executePipeline's
+// dispatch loop for exactly this purpose.
+func (em *ElementManager) AddPending(stageID, windowKey string, nowPT mtime.Time, encoded [][]byte) {
+	ss := em.stage(stageID)
+	ss.mu.Lock()
+	ss.pending = append(ss.pending, encoded...)
+	ss.mu.Unlock()
+
+	if len(encoded) > 0 {
+		em.NotePaneElement(stageID, windowKey, nowPT)
+	}
+}
+
+// SetWatermark records stageID's current watermark hold for colID.
+// stage.Execute is expected to call this as it processes a bundle,
+// using the ElementManager already threaded through executePipeline's
+// dispatch loop, so the hold is included in the stage's next Checkpoint.
+func (em *ElementManager) SetWatermark(stageID, colID string, wm mtime.Time) {
+	ss := em.stage(stageID)
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.watermarks == nil {
+		ss.watermarks = map[string]mtime.Time{}
+	}
+	ss.watermarks[colID] = wm
+}
+
+// AddTimers appends newly set, still-outstanding encoded timers to
+// stageID's timer queue. stage.Execute is expected to call this as it
+// sets timers while processing a bundle, using the ElementManager
+// already threaded through executePipeline's dispatch loop, so they're
+// included in the stage's next Checkpoint.
+func (em *ElementManager) AddTimers(stageID string, encoded [][]byte) {
+	ss := em.stage(stageID)
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.timers = append(ss.timers, encoded...)
+}
+
+// Checkpoint persists stageID's current pending elements, watermark
+// holds, and timers to cp, so the job can be resumed from this point
+// instead of replaying from its impulses.
+func (em *ElementManager) Checkpoint(cp Checkpointer, jobID, stageID string) error {
+	ss := em.stage(stageID)
+	ss.mu.Lock()
+	pending := append([][]byte(nil), ss.pending...)
+	watermarks := make(map[string]mtime.Time, len(ss.watermarks))
+	for col, wm := range ss.watermarks {
+		watermarks[col] = wm
+	}
+	timers := append([][]byte(nil), ss.timers...)
+	ss.mu.Unlock()
+
+	if err := cp.SaveBundle(jobID, stageID, pending); err != nil {
+		return fmt.Errorf("engine: checkpoint stage %v pending elements: %w", stageID, err)
+	}
+	if err := cp.SaveWatermarks(jobID, stageID, watermarks); err != nil {
+		return fmt.Errorf("engine: checkpoint stage %v watermarks: %w", stageID, err)
+	}
+	if err := cp.SaveTimers(jobID, stageID, timers); err != nil {
+		return fmt.Errorf("engine: checkpoint stage %v timers: %w", stageID, err)
+	}
+	return nil
+}
+
+// LoadCheckpoint restores a previously persisted StageCheckpoint into
+// stageID's runtime state, so its pending elements, watermark holds, and
+// timers are picked up the next time the stage is scheduled, in place
+// of re-priming it from its impulse.
+func (em *ElementManager) LoadCheckpoint(stageID string, chkpt *StageCheckpoint) {
+	if chkpt == nil {
+		return
+	}
+	ss := em.stage(stageID)
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.pending = append([][]byte(nil), chkpt.Pending...)
+	ss.watermarks = make(map[string]mtime.Time, len(chkpt.Watermarks))
+	for col, wm := range chkpt.Watermarks {
+		ss.watermarks[col] = wm
+	}
+	ss.timers = append([][]byte(nil), chkpt.Timers...)
+}
@@ -0,0 +1,102 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+)
+
+func TestBundlesAppliesBackpressure(t *testing.T) {
+	em := NewElementManager(Config{MaxBundleParallelism: 2})
+	em.AddStage("stage", nil, nil, nil)
+	for i := 0; i < 5; i++ {
+		em.Impulse("stage")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bundles := em.Bundles(ctx, func(error) {}, func() string { return "inst" })
+
+	// With a channel capacity of 2 and no consumer yet, the remaining
+	// bundles must still be sitting in the internal queue instead of
+	// having been scheduled unboundedly.
+	time.Sleep(20 * time.Millisecond)
+	em.mu.Lock()
+	queued := len(em.ready)
+	em.mu.Unlock()
+	if queued == 0 {
+		t.Fatalf("expected unconsumed bundles to queue behind the sized channel, got none queued")
+	}
+
+	var count int
+	for range bundles {
+		count++
+		if count == 5 {
+			cancel()
+		}
+	}
+	if count != 5 {
+		t.Fatalf("got %d bundles, want 5", count)
+	}
+}
+
+func TestAddPendingDrivesProcessingTimeTrigger(t *testing.T) {
+	em := NewElementManager(Config{})
+	em.AddStage("stage", nil, nil, nil)
+	em.StageAggregates("stage", WinStrat{
+		Trigger: &TriggerAfterProcessingTime{
+			TimestampTransforms: []TimestampTransform{DelayTransform{Delay: mtime.FromMilliseconds(10)}},
+		},
+	})
+
+	// AddPending is stage.Execute's entry point for newly produced
+	// elements; it should note the element against the window's trigger
+	// itself, rather than requiring a separate NotePaneElement call.
+	em.AddPending("stage", "window-1", mtime.FromMilliseconds(0), [][]byte{[]byte("elm-1")})
+
+	if fired := em.AdvanceProcessingTime(mtime.FromMilliseconds(5)); len(fired) != 0 {
+		t.Fatalf("AdvanceProcessingTime(5) fired early: %v", fired)
+	}
+	fired := em.AdvanceProcessingTime(mtime.FromMilliseconds(10))
+	if len(fired) != 1 || fired[0].WindowKey != "window-1" {
+		t.Fatalf("AdvanceProcessingTime(10) = %v, want a single firing for window-1", fired)
+	}
+}
+
+func TestStageAggregatesIgnoresNonProcessingTimeTriggers(t *testing.T) {
+	em := NewElementManager(Config{})
+	em.AddStage("stage", nil, nil, nil)
+	// Only TriggerAfterProcessingTime and
+	// TriggerAfterSynchronizedProcessingTime are tracked per window;
+	// anything else (here, a bare nil standing in for
+	// eg. the default/watermark trigger buildTrigger falls back to) must
+	// not be armed, or AddPending would track a per-window timer that's
+	// never polled by anything.
+	em.StageAggregates("stage", WinStrat{Trigger: nil})
+
+	em.AddPending("stage", "window-1", mtime.FromMilliseconds(0), [][]byte{[]byte("elm-1")})
+
+	ss := em.stage("stage")
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.procTimeTrigger != nil || len(ss.procTimeTimers) != 0 {
+		t.Fatalf("stage tracked a processing-time timer for a non-processing-time trigger: trigger=%v timers=%v", ss.procTimeTrigger, ss.procTimeTimers)
+	}
+}
@@ -0,0 +1,40 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import "github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+
+// Trigger determines when a window's accumulated pane should be emitted
+// downstream. For a stage whose WinStrat trigger is a processing-time
+// trigger (see StageAggregates), the ElementManager keeps one Trigger
+// instance per currently open window, cloned from the configured
+// prototype the first time an element lands in that window, so each
+// window's firing state is tracked independently.
+type Trigger interface {
+	// Clone returns a new Trigger with the same configuration as this one,
+	// but none of its per-window firing state.
+	Clone() Trigger
+	// OnNewWindow resets the trigger's firing state for a new pane.
+	OnNewWindow()
+	// OnElement notifies the trigger that an element arrived for the
+	// current pane at local processing time nowPT, returning the
+	// processing time the trigger should next be re-evaluated at, or 0
+	// if it has no processing-time component.
+	OnElement(nowPT mtime.Time) mtime.Time
+	// OnProcessingTime reports whether the trigger is satisfied now that
+	// the processing-time watermark has reached nowPT.
+	OnProcessingTime(nowPT mtime.Time) bool
+}
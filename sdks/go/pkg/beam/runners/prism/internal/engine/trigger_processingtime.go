@@ -0,0 +1,170 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import "github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+
+// TimestampTransform adjusts a processing time relative to either the
+// local input arrival time or the firing's window, mirroring
+// pipepb.TimestampTransform. These compose to determine when an
+// AfterProcessingTime style trigger is next eligible to fire.
+type TimestampTransform interface {
+	// Apply returns the target processing time produced by applying this
+	// transform to pt, the processing time the transform chain is anchored to.
+	Apply(pt mtime.Time) mtime.Time
+}
+
+// DelayTransform adds a fixed duration to the anchor processing time.
+type DelayTransform struct {
+	Delay mtime.Time // Delay, in milliseconds.
+}
+
+// Apply implements TimestampTransform.
+func (d DelayTransform) Apply(pt mtime.Time) mtime.Time {
+	return pt + d.Delay
+}
+
+// AlignToTransform rounds the anchor processing time up to the next
+// `offset + k*period` boundary, for the smallest integer k (negative when
+// pt is more than a period before offset) such that the result is not
+// before pt.
+type AlignToTransform struct {
+	Period mtime.Time
+	Offset mtime.Time
+}
+
+// Apply implements TimestampTransform.
+func (a AlignToTransform) Apply(pt mtime.Time) mtime.Time {
+	if a.Period <= 0 {
+		return pt
+	}
+	since := pt - a.Offset
+	k := since / a.Period
+	aligned := a.Offset + k*a.Period
+	if aligned < pt {
+		aligned += a.Period
+	}
+	return aligned
+}
+
+// TriggerAfterProcessingTime fires relative to the processing time at
+// which the first element of the pane arrived, delayed or aligned by
+// TimestampTransforms. It behaves as a one-shot trigger: once it fires it
+// is finished, so a wrapping TriggerRepeatedly is required to reset it.
+//
+// TriggerAfterProcessingTime implements Trigger, and is evaluated by the
+// ElementManager's processing-time timer machinery: NotePaneElement
+// calls OnElement as elements land in a window, and AdvanceProcessingTime
+// calls OnProcessingTime as the local clock moves, for stages whose
+// windowing strategy registered it through StageAggregates.
+type TriggerAfterProcessingTime struct {
+	TimestampTransforms []TimestampTransform
+
+	finished bool
+	target   mtime.Time
+	set      bool
+}
+
+var _ Trigger = (*TriggerAfterProcessingTime)(nil)
+
+// Clone implements Trigger.
+func (t *TriggerAfterProcessingTime) Clone() Trigger {
+	return &TriggerAfterProcessingTime{TimestampTransforms: t.TimestampTransforms}
+}
+
+// OnNewWindow implements Trigger.
+func (t *TriggerAfterProcessingTime) OnNewWindow() {
+	t.finished = false
+	t.set = false
+	t.target = 0
+}
+
+// OnElement implements Trigger, registering the timer target the first
+// time an element is seen for the current pane, based on the processing
+// time watermark at arrival.
+func (t *TriggerAfterProcessingTime) OnElement(nowPT mtime.Time) mtime.Time {
+	if !t.set {
+		target := nowPT
+		for _, tt := range t.TimestampTransforms {
+			target = tt.Apply(target)
+		}
+		t.target = target
+		t.set = true
+	}
+	return t.target
+}
+
+// OnProcessingTime implements Trigger, reporting whether the trigger is
+// satisfied by the provided processing-time watermark, and marking it
+// finished if so.
+func (t *TriggerAfterProcessingTime) OnProcessingTime(nowPT mtime.Time) bool {
+	if t.finished || !t.set {
+		return false
+	}
+	if nowPT >= t.target {
+		t.finished = true
+		return true
+	}
+	return false
+}
+
+// TriggerAfterSynchronizedProcessingTime fires once the synchronized
+// processing-time watermark -- the minimum processing time watermark
+// across all upstream workers processing this stage -- passes the
+// moment the pane's first element arrived. Like
+// TriggerAfterProcessingTime, it is a one-shot trigger, and is evaluated
+// the same way, through the ElementManager's processing-time timer
+// machinery.
+type TriggerAfterSynchronizedProcessingTime struct {
+	finished bool
+	target   mtime.Time
+	set      bool
+}
+
+var _ Trigger = (*TriggerAfterSynchronizedProcessingTime)(nil)
+
+// Clone implements Trigger.
+func (t *TriggerAfterSynchronizedProcessingTime) Clone() Trigger {
+	return &TriggerAfterSynchronizedProcessingTime{}
+}
+
+// OnNewWindow implements Trigger.
+func (t *TriggerAfterSynchronizedProcessingTime) OnNewWindow() {
+	t.finished = false
+	t.set = false
+	t.target = 0
+}
+
+// OnElement implements Trigger.
+func (t *TriggerAfterSynchronizedProcessingTime) OnElement(nowPT mtime.Time) mtime.Time {
+	if !t.set {
+		t.target = nowPT
+		t.set = true
+	}
+	return t.target
+}
+
+// OnProcessingTime implements Trigger.
+func (t *TriggerAfterSynchronizedProcessingTime) OnProcessingTime(synchronizedPT mtime.Time) bool {
+	if t.finished || !t.set {
+		return false
+	}
+	if synchronizedPT >= t.target {
+		t.finished = true
+		return true
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"testing"
+
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/core/graph/mtime"
+)
+
+func TestAfterProcessingTime_FiresThroughElementManager(t *testing.T) {
+	em := NewElementManager(Config{})
+	em.AddStage("stage", nil, nil, nil)
+	em.StageAggregates("stage", WinStrat{
+		Trigger: &TriggerAfterProcessingTime{
+			TimestampTransforms: []TimestampTransform{DelayTransform{Delay: mtime.FromMilliseconds(10)}},
+		},
+	})
+
+	em.NotePaneElement("stage", "window-1", mtime.FromMilliseconds(0))
+
+	if fired := em.AdvanceProcessingTime(mtime.FromMilliseconds(5)); len(fired) != 0 {
+		t.Fatalf("AdvanceProcessingTime(5) fired early: %v", fired)
+	}
+
+	fired := em.AdvanceProcessingTime(mtime.FromMilliseconds(10))
+	if len(fired) != 1 || fired[0].StageID != "stage" || fired[0].WindowKey != "window-1" {
+		t.Fatalf("AdvanceProcessingTime(10) = %v, want a single firing for stage/window-1", fired)
+	}
+
+	// The wrapped trigger is one-shot: the window shouldn't fire again.
+	if fired := em.AdvanceProcessingTime(mtime.FromMilliseconds(20)); len(fired) != 0 {
+		t.Fatalf("AdvanceProcessingTime(20) refired a finished window: %v", fired)
+	}
+}
+
+func TestAfterSynchronizedProcessingTime_FiresThroughElementManager(t *testing.T) {
+	em := NewElementManager(Config{})
+	em.AddStage("stage", nil, nil, nil)
+	em.StageAggregates("stage", WinStrat{Trigger: &TriggerAfterSynchronizedProcessingTime{}})
+
+	em.NotePaneElement("stage", "window-1", mtime.FromMilliseconds(100))
+
+	fired := em.AdvanceProcessingTime(mtime.FromMilliseconds(100))
+	if len(fired) != 1 || fired[0].WindowKey != "window-1" {
+		t.Fatalf("AdvanceProcessingTime(100) = %v, want a single firing for window-1", fired)
+	}
+}
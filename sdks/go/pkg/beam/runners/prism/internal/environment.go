@@ -0,0 +1,144 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+
+	"github.com/apache/beam/sdks/v2/go/container/tools"
+	pipepb "github.com/apache/beam/sdks/v2/go/pkg/beam/model/pipeline_v1"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/jobservices"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/urns"
+	"github.com/apache/beam/sdks/v2/go/pkg/beam/runners/prism/internal/worker"
+	"google.golang.org/protobuf/proto"
+)
+
+// dispatchEnvironment starts whatever is needed for the SDK harness behind
+// envID to dial back in to wk, based on the environment's URN. Unlike
+// runEnvironment, which only understands the Go SDK's own loopback mode,
+// this allows SDKs that ship their own containers (eg. Python, Java) to
+// participate in a Prism pipeline, which is required for cross-language
+// stages.
+func dispatchEnvironment(ctx context.Context, j *jobservices.Job, envID string, env *pipepb.Environment, wk *worker.W) error {
+	switch env.GetUrn() {
+	case urns.EnvDocker:
+		return runDockerEnvironment(ctx, j, envID, env, wk)
+	default:
+		// Everything else, including urns.EnvExternal, falls back to the
+		// existing loopback behavior. EnvExternal isn't only used by a
+		// pre-warmed SDK worker pool managed outside this process -- the Go
+		// SDK's own loopback environment sets it too -- so treating it as
+		// an unconditional no-op here previously broke Go SDK loopback
+		// pipelines. runEnvironment has nothing container-specific to
+		// launch, so it's also a safe no-op-ish wait for a genuinely
+		// externally-managed harness that dials back in to wk's endpoints
+		// on its own; RunPipeline's post-dispatch timeout fails the job if
+		// it never does.
+		return runEnvironment(ctx, j, envID, wk)
+	}
+}
+
+// runDockerEnvironment launches the SDK harness container described by
+// env's DockerPayload, wiring it up to wk's FnAPI services, and forwards
+// its stdout/stderr into the job's log stream so that failures inside the
+// container are visible alongside the rest of the job's diagnostics.
+func runDockerEnvironment(ctx context.Context, j *jobservices.Job, envID string, env *pipepb.Environment, wk *worker.W) error {
+	var payload pipepb.DockerPayload
+	if err := proto.Unmarshal(env.GetPayload(), &payload); err != nil {
+		return fmt.Errorf("unable to decode DockerPayload for environment %v: %w", envID, err)
+	}
+
+	endpoint := wk.Endpoint()
+	cmd := exec.CommandContext(ctx, "docker", "run",
+		"--rm",
+		"--network=host",
+		payload.GetContainerImage(),
+		"--id="+envID,
+		"--control_endpoint="+endpoint,
+		"--logging_endpoint="+endpoint,
+		"--artifact_endpoint="+endpoint,
+		"--provision_endpoint="+endpoint,
+	)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("unable to attach stdout for environment %v: %w", envID, err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("unable to attach stderr for environment %v: %w", envID, err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("unable to start docker container %v for environment %v: %w", payload.GetContainerImage(), envID, err)
+	}
+
+	logContainerOutput(j, envID, "stdout", stdout, slog.LevelInfo)
+	logContainerOutput(j, envID, "stderr", stderr, slog.LevelError)
+
+	go func() {
+		if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+			err = fmt.Errorf("docker environment %v for environment %v exited unexpectedly: %w", payload.GetContainerImage(), envID, err)
+			j.Logger.Error("docker environment exited", slog.String("envID", envID), slog.Any("error", err))
+			j.Failed(err)
+			// Failed alone only records the job's terminal state; the
+			// pipeline's goroutines (bundle execution, the other
+			// environments' containers) are still running against ctx and
+			// need to be told to stop, the same way RunPipeline's
+			// post-dispatch connection timeout does.
+			j.CancelFn(err)
+		}
+	}()
+
+	return nil
+}
+
+// logContainerOutput forwards each line written to r into the job's logger,
+// so SDK container output is captured alongside the rest of the job's
+// runner-side log output instead of being lost. Each line is logged at the
+// severity tools.DetectSeverity recognizes it as -- the same per-line
+// SDK logging formats tools.BufferedLogger detects inside the container
+// itself -- falling back to defaultLevel for lines that don't match any
+// of them. This intentionally reuses only tools.DetectSeverity, not
+// tools.BufferedLogger itself: BufferedLogger buffers and flushes
+// through a tools.Logger, the bootloader's FnAPI logging client, which
+// isn't something the runner process has or should construct -- it logs
+// runner-side through j.Logger instead.
+func logContainerOutput(j *jobservices.Job, envID, stream string, r io.ReadCloser, defaultLevel slog.Level) {
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := scanner.Text()
+			level := defaultLevel
+			switch tools.DetectSeverity(line) {
+			case tools.SeverityError:
+				level = slog.LevelError
+			case tools.SeverityWarn:
+				level = slog.LevelWarn
+			case tools.SeverityInfo:
+				level = slog.LevelInfo
+			case tools.SeverityDebug:
+				level = slog.LevelDebug
+			}
+			j.Logger.Log(context.Background(), level, line, slog.String("envID", envID), slog.String("stream", stream))
+		}
+	}()
+}
@@ -22,7 +22,11 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"runtime"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -47,16 +51,16 @@ func RunPipeline(j *jobservices.Job) {
 	j.SendMsg("starting " + j.String())
 	j.Start()
 
-	// In a "proper" runner, we'd iterate through all the
-	// environments, and start up docker containers, but
-	// here, we only want and need the go one, operating
-	// in loopback mode.
+	// Each stage is dispatched to the worker for its declared EnvironmentId,
+	// so cross-language pipelines (eg. a Python ParDo feeding a Go Combine)
+	// can run side by side, as long as each environment's harness can be
+	// started and dial back in to its worker.
 	envs := j.Pipeline.GetComponents().GetEnvironments()
 	wks := map[string]*worker.W{}
-	for envID := range envs {
+	for envID, env := range envs {
 		wk := j.MakeWorker(envID)
 		wks[envID] = wk
-		if err := runEnvironment(j.RootCtx, j, envID, wk); err != nil {
+		if err := dispatchEnvironment(j.RootCtx, j, envID, env, wk); err != nil {
 			j.Failed(fmt.Errorf("failed to start environment %v for job %v: %w", envID, j, err))
 			return
 		}
@@ -145,21 +149,45 @@ func executePipeline(ctx context.Context, wks map[string]*worker.W, j *jobservic
 	topo := prepro.preProcessGraph(comps, j)
 	ts := comps.GetTransforms()
 
-	config := engine.Config{}
+	config := engine.Config{MaxBundleParallelism: runtime.NumCPU()}
 	m := j.PipelineOptions().AsMap()
 	if experimentsSlice, ok := m["beam:option:experiments:v1"].([]interface{}); ok {
 		for _, exp := range experimentsSlice {
-			if expStr, ok := exp.(string); ok {
-				if expStr == "prism_enable_rtc" {
-					config.EnableRTC = true
-					break // Found it, no need to check the rest of the slice
+			expStr, ok := exp.(string)
+			if !ok {
+				continue
+			}
+			switch {
+			case expStr == "prism_enable_rtc":
+				config.EnableRTC = true
+			case strings.HasPrefix(expStr, "prism_parallelism="):
+				n, err := strconv.Atoi(strings.TrimPrefix(expStr, "prism_parallelism="))
+				if err != nil || n <= 0 {
+					j.Logger.Warn("ignoring invalid prism_parallelism experiment", slog.String("value", expStr))
+					continue
 				}
+				config.MaxBundleParallelism = n
+			case strings.HasPrefix(expStr, "prism_checkpoint_dir="):
+				dir := strings.TrimPrefix(expStr, "prism_checkpoint_dir=")
+				config.Checkpointer = engine.NewFileCheckpointer(dir)
 			}
 		}
 	}
 
 	em := engine.NewElementManager(config)
 
+	var checkpointed map[string]*engine.StageCheckpoint
+	if config.Checkpointer != nil {
+		var err error
+		checkpointed, err = config.Checkpointer.Load(j.String())
+		if err != nil {
+			return fmt.Errorf("prism error loading checkpoint for job %v: %w", j, err)
+		}
+		if len(checkpointed) > 0 {
+			j.Logger.Info("resuming from checkpoint", slog.String("job", j.String()), slog.Int("stages", len(checkpointed)))
+		}
+	}
+
 	// TODO move this loop and code into the preprocessor instead.
 	stages := map[string]*stage{}
 	var impulses []string
@@ -337,19 +365,62 @@ func executePipeline(ctx context.Context, wks map[string]*worker.W, j *jobservic
 		}
 	}
 
+	// Restore any stage state persisted by a prior, checkpointed run of
+	// this job, so streaming tests (TestStream-driven or otherwise) can
+	// survive a restart instead of re-priming from scratch.
+	for stageID, chkpt := range checkpointed {
+		em.LoadCheckpoint(stageID, chkpt)
+	}
+
 	// Prime the initial impulses, since we now know what consumes them.
+	// A stage is only skipped if its checkpoint actually restored some
+	// state: Checkpointer.Load can return an entry for a stage that was
+	// registered but never received any elements, pending or otherwise
+	// (eg. checkpointed before its first bundle ran), and skipping its
+	// impulse in that case would silently drop the stage's input rather
+	// than avoid duplicating it.
 	for _, id := range impulses {
+		if chkpt, ok := checkpointed[id]; ok && checkpointHasState(chkpt) {
+			continue
+		}
 		em.Impulse(id)
 	}
 
 	// Use an errgroup to limit max parallelism for the pipeline.
 	eg, egctx := errgroup.WithContext(ctx)
-	eg.SetLimit(8)
+	eg.SetLimit(config.MaxBundleParallelism)
 
 	var instID uint64
+	var inFlight sync.Map     // stageID -> *atomic.Int64, in-flight bundle counts for bottleneck diagnosis.
+	var lastCheckpoint sync.Map // stageID -> time.Time, throttles checkpoint flushes.
 	bundles := em.Bundles(egctx, j.CancelFn, func() string {
 		return fmt.Sprintf("inst%03d", atomic.AddUint64(&instID, 1))
 	})
+
+	// Advance the ElementManager's local processing-time watermark on a
+	// tick, rather than only when other pipeline work happens to touch
+	// it, so AfterProcessingTime and AfterSynchronizedProcessingTime
+	// triggers registered by StageAggregates actually fire. A fired
+	// trigger means its stage has a pane ready to emit, so schedule it.
+	// This runs outside the eg/egctx errgroup deliberately: it's a
+	// permanent background loop, and occupying one of eg's limited
+	// goroutine slots for its whole lifetime would starve bundle
+	// execution under a small MaxBundleParallelism.
+	go func() {
+		ticker := time.NewTicker(processingTimeTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-egctx.Done():
+				return
+			case <-ticker.C:
+				for _, fired := range em.AdvanceProcessingTime(mtime.Now()) {
+					em.ScheduleStage(fired.StageID)
+				}
+			}
+		}
+	}()
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -365,17 +436,68 @@ func executePipeline(ctx context.Context, wks map[string]*worker.W, j *jobservic
 			eg.Go(func() error {
 				s := stages[rb.StageID]
 				wk := wks[s.envID]
+
+				v, _ := inFlight.LoadOrStore(rb.StageID, new(atomic.Int64))
+				count := v.(*atomic.Int64)
+				count.Add(1)
+				j.Logger.Debug("bundle started", slog.String("stage", rb.StageID), slog.Int64("inFlight", count.Load()))
+				defer func() {
+					j.Logger.Debug("bundle finished", slog.String("stage", rb.StageID), slog.Int64("inFlight", count.Add(-1)))
+				}()
+
+				// s.Execute receives em precisely so it can report what the
+				// bundle produced back to the ElementManager as it runs:
+				// AddPending for output elements, SetWatermark for holds it
+				// sets or clears, and AddTimers for timers it sets. Without
+				// those calls a stage's checkpointed state -- and thus what
+				// maybeCheckpointStage below persists -- stays empty.
 				if err := s.Execute(ctx, j, wk, comps, em, rb); err != nil {
 					// Ensure we clean up on bundle failure
 					em.FailBundle(rb)
 					return err
 				}
+				if config.Checkpointer != nil {
+					maybeCheckpointStage(config.Checkpointer, j.String(), rb.StageID, em, &lastCheckpoint)
+				}
 				return nil
 			})
 		}
 	}
 }
 
+// checkpointHasState reports whether chkpt actually restored some stage
+// state -- pending elements, a watermark hold, or a timer -- as opposed
+// to merely existing as an empty entry for a registered stage.
+func checkpointHasState(chkpt *engine.StageCheckpoint) bool {
+	return chkpt != nil && (len(chkpt.Pending) > 0 || len(chkpt.Watermarks) > 0 || len(chkpt.Timers) > 0)
+}
+
+// checkpointFlushInterval bounds how often a given stage's state is
+// persisted, so checkpointing overhead stays bounded on high-throughput
+// pipelines instead of flushing after every single bundle.
+const checkpointFlushInterval = 10 * time.Second
+
+// processingTimeTick bounds how often executePipeline's background clock
+// advances the ElementManager's local processing-time watermark against
+// stages' registered triggers, so AfterProcessingTime-style triggers
+// fire close to their target instead of only when other pipeline work
+// happens to wake the stage.
+const processingTimeTick = 100 * time.Millisecond
+
+// maybeCheckpointStage persists stageID's current pending elements,
+// watermark holds, and timers to cp, throttled by checkpointFlushInterval
+// per stage via last.
+func maybeCheckpointStage(cp engine.Checkpointer, jobID, stageID string, em *engine.ElementManager, last *sync.Map) {
+	now := time.Now()
+	if v, ok := last.Load(stageID); ok && now.Sub(v.(time.Time)) < checkpointFlushInterval {
+		return
+	}
+	last.Store(stageID, now)
+	if err := em.Checkpoint(cp, jobID, stageID); err != nil {
+		slog.Error("checkpoint flush failed", slog.String("stage", stageID), slog.Any("error", err))
+	}
+}
+
 func collectionPullDecoder(coldCId string, coders map[string]*pipepb.Coder, comps *pipepb.Components) func(io.Reader) []byte {
 	cID, err := lpUnknownCoders(coldCId, coders, comps.GetCoders())
 	if err != nil {
@@ -456,9 +578,34 @@ func buildTrigger(tpb *pipepb.Trigger) engine.Trigger {
 		}
 	case *pipepb.Trigger_Repeat_:
 		return &engine.TriggerRepeatedly{Repeated: buildTrigger(at.Repeat.GetSubtrigger())}
-	case *pipepb.Trigger_AfterProcessingTime_, *pipepb.Trigger_AfterSynchronizedProcessingTime_:
-		panic(fmt.Sprintf("unsupported trigger: %v", prototext.Format(tpb)))
+	case *pipepb.Trigger_AfterProcessingTime_:
+		return &engine.TriggerAfterProcessingTime{
+			TimestampTransforms: buildTimestampTransforms(at.AfterProcessingTime.GetTimestampTransforms()),
+		}
+	case *pipepb.Trigger_AfterSynchronizedProcessingTime_:
+		return &engine.TriggerAfterSynchronizedProcessingTime{}
 	default:
 		return &engine.TriggerDefault{}
 	}
 }
+
+// buildTimestampTransforms converts the protocol buffer representation of a
+// chain of processing-time adjustments (as used by AfterProcessingTime
+// triggers) to the engine representation.
+func buildTimestampTransforms(tts []*pipepb.TimestampTransform) []engine.TimestampTransform {
+	var out []engine.TimestampTransform
+	for _, tt := range tts {
+		switch at := tt.GetTimestampTransform().(type) {
+		case *pipepb.TimestampTransform_Delay_:
+			out = append(out, engine.DelayTransform{Delay: mtime.FromMilliseconds(at.Delay.GetDelayMillis())})
+		case *pipepb.TimestampTransform_AlignTo_:
+			out = append(out, engine.AlignToTransform{
+				Period: mtime.FromMilliseconds(at.AlignTo.GetPeriod()),
+				Offset: mtime.FromMilliseconds(at.AlignTo.GetOffset()),
+			})
+		default:
+			panic(fmt.Sprintf("unsupported timestamp transform: %v", prototext.Format(tt)))
+		}
+	}
+	return out
+}